@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// defaultChunkSize is used by chunkedWriter when the caller doesn't ask for
+// a specific size.
+const defaultChunkSize = 4096
+
+// chunkedReader decodes an HTTP/1.1 "chunked" transfer-coded body (RFC 7230
+// §4.1), modeled after net/http/internal's chunked reader: read a hex chunk
+// size line, read exactly that many bytes plus the trailing CRLF, and on a
+// zero-size chunk consume the (optional) trailer header block.
+type chunkedReader struct {
+	r       *bufio.Reader
+	n       int64 // bytes remaining in the current chunk
+	err     error
+	sawEOF  bool
+	trailer Header
+}
+
+func newChunkedReader(r *bufio.Reader) *chunkedReader {
+	return &chunkedReader{r: r}
+}
+
+// readChunkLine reads a "<hex-size>[;ext...]\r\n" line and returns the size.
+func (cr *chunkedReader) readChunkLine() (int64, error) {
+	s, err := ReadLine(cr.r)
+	if err != nil {
+		return 0, err
+	}
+	// Chunk extensions are separated by ';' and are of no use to a proxy.
+	if i := strings.IndexByte(s, ';'); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, &HttpError{"chunked: empty chunk size line"}
+	}
+	n, err := strconv.ParseInt(s, 16, 64)
+	if err != nil {
+		return 0, &HttpError{"chunked: malformed chunk size: " + s}
+	}
+	return n, nil
+}
+
+// Read implements io.Reader, handing back decoded body bytes with the
+// chunk framing stripped out.
+func (cr *chunkedReader) Read(p []byte) (n int, err error) {
+	if cr.err != nil {
+		return 0, cr.err
+	}
+	if cr.sawEOF {
+		return 0, io.EOF
+	}
+
+	if cr.n == 0 {
+		size, err := cr.readChunkLine()
+		if err != nil {
+			cr.err = err
+			return 0, err
+		}
+		if size == 0 {
+			if err := cr.readTrailer(); err != nil {
+				cr.err = err
+				return 0, err
+			}
+			cr.sawEOF = true
+			return 0, io.EOF
+		}
+		cr.n = size
+	}
+
+	if int64(len(p)) > cr.n {
+		p = p[:cr.n]
+	}
+	n, err = cr.r.Read(p)
+	cr.n -= int64(n)
+	if err != nil {
+		cr.err = err
+		return n, err
+	}
+	if cr.n == 0 {
+		if err := readCheckCRLF(cr.r); err != nil {
+			cr.err = err
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// readTrailer parses the trailer header block that follows the final
+// "0\r\n" chunk into cr.trailer. Real servers rarely send one, but when
+// they do it's the only place those header values live.
+func (cr *chunkedReader) readTrailer() error {
+	cr.trailer = make(Header)
+	for {
+		s, err := ReadLine(cr.r)
+		if err != nil {
+			return newHttpError("chunked: reading trailer:", err)
+		}
+		if s == "" {
+			return nil
+		}
+		f := splitHeader(s)
+		if len(f) == 2 {
+			cr.trailer.Add(f[0], f[1])
+		}
+	}
+}
+
+// Trailer returns the trailer headers decoded after the terminating
+// chunk. It's only meaningful once Read has returned io.EOF.
+func (cr *chunkedReader) Trailer() Header {
+	return cr.trailer
+}
+
+// chunkedWriter frames whatever is written to it as HTTP/1.1 chunked
+// transfer-coding, writing to the underlying io.Writer in pieces of at most
+// size bytes.
+type chunkedWriter struct {
+	w    io.Writer
+	size int
+}
+
+func newChunkedWriter(w io.Writer, size int) *chunkedWriter {
+	if size <= 0 {
+		size = defaultChunkSize
+	}
+	return &chunkedWriter{w: w, size: size}
+}
+
+func (cw *chunkedWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > cw.size {
+			chunk = chunk[:cw.size]
+		}
+		if _, err = io.WriteString(cw.w, strconv.FormatInt(int64(len(chunk)), 16)+"\r\n"); err != nil {
+			return n, err
+		}
+		var wn int
+		if wn, err = cw.w.Write(chunk); err != nil {
+			return n, err
+		}
+		if _, err = io.WriteString(cw.w, "\r\n"); err != nil {
+			return n, err
+		}
+		n += wn
+		p = p[wn:]
+	}
+	return n, nil
+}
+
+// Close writes the terminating zero-size chunk. It does not close the
+// underlying writer.
+func (cw *chunkedWriter) Close() error {
+	_, err := io.WriteString(cw.w, "0\r\n\r\n")
+	return err
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestChunkedReader(t *testing.T) {
+	testCases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "single chunk",
+			in:   "5\r\nhello\r\n0\r\n\r\n",
+			want: "hello",
+		},
+		{
+			name: "multiple chunks",
+			in:   "4\r\nWiki\r\n5\r\npedia\r\n0\r\n\r\n",
+			want: "Wikipedia",
+		},
+		{
+			name: "chunk size extension is ignored",
+			in:   "5;foo=bar\r\nhello\r\n0\r\n\r\n",
+			want: "hello",
+		},
+		{
+			name: "trailer after final chunk is consumed, not returned",
+			in:   "5\r\nhello\r\n0\r\nX-Checksum: deadbeef\r\n\r\n",
+			want: "hello",
+		},
+		{
+			name: "empty body",
+			in:   "0\r\n\r\n",
+			want: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := newChunkedReader(bufio.NewReader(strings.NewReader(tc.in)))
+			got, err := ioutil.ReadAll(cr)
+			if err != nil {
+				t.Fatalf("ReadAll: %v", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestChunkedReaderTrailer(t *testing.T) {
+	in := "5\r\nhello\r\n0\r\nX-Checksum: deadbeef\r\n\r\n"
+	cr := newChunkedReader(bufio.NewReader(strings.NewReader(in)))
+	if _, err := ioutil.ReadAll(cr); err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if got := cr.Trailer().Get("X-Checksum"); got != "deadbeef" {
+		t.Errorf("Trailer().Get(X-Checksum) = %q, want %q", got, "deadbeef")
+	}
+}
+
+func TestChunkedReaderMalformedSize(t *testing.T) {
+	cr := newChunkedReader(bufio.NewReader(strings.NewReader("zz\r\nhello\r\n0\r\n\r\n")))
+	if _, err := ioutil.ReadAll(cr); err == nil {
+		t.Fatal("expected an error for a malformed chunk size, got nil")
+	}
+}
+
+func TestChunkedWriter(t *testing.T) {
+	var buf strings.Builder
+	cw := newChunkedWriter(&buf, 4)
+	if _, err := io.WriteString(cw, "Wikipedia"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Writing back through chunkedReader should round-trip to the
+	// original bytes regardless of how the writer chose to split chunks.
+	cr := newChunkedReader(bufio.NewReader(strings.NewReader(buf.String())))
+	got, err := ioutil.ReadAll(cr)
+	if err != nil {
+		t.Fatalf("ReadAll round-trip: %v", err)
+	}
+	if string(got) != "Wikipedia" {
+		t.Errorf("round-trip got %q, want %q", got, "Wikipedia")
+	}
+}
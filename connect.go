@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io"
+	"net"
+)
+
+// ConnectPolicy decides whether a CONNECT request may be tunneled, based on
+// both the target host and port. DeniedHosts is checked first and always
+// wins; an empty AllowedHosts means any host is permitted (subject to
+// DeniedHosts and AllowedPorts).
+type ConnectPolicy struct {
+	AllowedPorts map[string]bool
+	AllowedHosts map[string]bool
+	DeniedHosts  map[string]bool
+}
+
+// newDefaultConnectPolicy only allows the ports browsers actually CONNECT
+// for, HTTPS (443) and, historically, NNTPS (563), to any host. Allowing
+// arbitrary ports/hosts would turn the proxy into an open relay.
+func newDefaultConnectPolicy() *ConnectPolicy {
+	return &ConnectPolicy{
+		AllowedPorts: map[string]bool{"443": true, "563": true},
+	}
+}
+
+// NewConnectPolicy builds a ConnectPolicy from operator-supplied port and
+// host lists, for wiring up from a config file or flags. An empty
+// allowedHosts means any host is allowed.
+func NewConnectPolicy(allowedPorts, allowedHosts, deniedHosts []string) *ConnectPolicy {
+	p := &ConnectPolicy{
+		AllowedPorts: make(map[string]bool),
+		AllowedHosts: make(map[string]bool),
+		DeniedHosts:  make(map[string]bool),
+	}
+	for _, port := range allowedPorts {
+		p.AllowedPorts[port] = true
+	}
+	for _, host := range allowedHosts {
+		p.AllowedHosts[host] = true
+	}
+	for _, host := range deniedHosts {
+		p.DeniedHosts[host] = true
+	}
+	return p
+}
+
+// connectPolicy is the policy consulted by handleConnect. Operators can
+// replace it wholesale (e.g. connectPolicy = NewConnectPolicy(...)) to
+// configure which hosts/ports CONNECT may reach.
+var connectPolicy = newDefaultConnectPolicy()
+
+// Allowed reports whether hostport (the "host:port" authority of a CONNECT
+// request) may be tunneled under p.
+func (p *ConnectPolicy) Allowed(hostport string) bool {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return false
+	}
+	if p.DeniedHosts[host] {
+		return false
+	}
+	if !p.AllowedPorts[port] {
+		return false
+	}
+	if len(p.AllowedHosts) > 0 && !p.AllowedHosts[host] {
+		return false
+	}
+	return true
+}
+
+// handleConnect implements the CONNECT method: dial the requested host,
+// tell the client the tunnel is up, then shuffle bytes between client and
+// server until either side closes. It blocks until the tunnel ends.
+func handleConnect(r *Request, client net.Conn) error {
+	if !connectPolicy.Allowed(r.URL.Host) {
+		return &HttpError{"CONNECT not allowed to " + r.URL.Host}
+	}
+
+	srv, err := net.Dial("tcp", r.URL.Host)
+	if err != nil {
+		return newHttpError("Dialing CONNECT target "+r.URL.Host+":", err)
+	}
+	defer srv.Close()
+
+	if _, err := io.WriteString(client, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		return newHttpError("Writing CONNECT response:", err)
+	}
+
+	errCh := make(chan error, 2)
+	go tunnelCopy(errCh, srv, client)
+	go tunnelCopy(errCh, client, srv)
+	return <-errCh
+}
+
+func tunnelCopy(errCh chan<- error, dst io.Writer, src io.Reader) {
+	_, err := io.Copy(dst, src)
+	errCh <- err
+}
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestConnectPolicyDefaultAllowsStandardPorts(t *testing.T) {
+	p := newDefaultConnectPolicy()
+
+	cases := []struct {
+		host string
+		want bool
+	}{
+		{"example.com:443", true},
+		{"example.com:563", true},
+		{"example.com:80", false},
+		{"example.com:22", false},
+	}
+	for _, tc := range cases {
+		if got := p.Allowed(tc.host); got != tc.want {
+			t.Errorf("Allowed(%q) = %v, want %v", tc.host, got, tc.want)
+		}
+	}
+}
+
+func TestConnectPolicyRejectsMalformedAuthority(t *testing.T) {
+	p := newDefaultConnectPolicy()
+	if p.Allowed("not-a-host-port") {
+		t.Error("expected an authority without a port to be rejected")
+	}
+	if p.Allowed("") {
+		t.Error("expected an empty authority to be rejected")
+	}
+}
+
+func TestConnectPolicyDeniedHostWinsOverAllowedPort(t *testing.T) {
+	p := NewConnectPolicy([]string{"443"}, nil, []string{"evil.example"})
+	if p.Allowed("evil.example:443") {
+		t.Error("expected a denied host to be rejected even on an allowed port")
+	}
+	if !p.Allowed("good.example:443") {
+		t.Error("expected a host not on the deny list to be allowed")
+	}
+}
+
+func TestConnectPolicyAllowedHostsRestrictsToList(t *testing.T) {
+	p := NewConnectPolicy([]string{"443"}, []string{"good.example"}, nil)
+	if !p.Allowed("good.example:443") {
+		t.Error("expected the listed host to be allowed")
+	}
+	if p.Allowed("other.example:443") {
+		t.Error("expected a host outside AllowedHosts to be rejected once AllowedHosts is non-empty")
+	}
+}
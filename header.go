@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Header holds HTTP header fields, keyed by their canonical form with one
+// slice entry per value. This mirrors net/http.Header so that repeated
+// fields (Set-Cookie, Via, X-Forwarded-For, ...) aren't silently collapsed
+// to the last value seen.
+type Header map[string][]string
+
+// Add appends value to the list of values associated with key, after
+// canonicalizing key.
+func (h Header) Add(key, value string) {
+	h[CanonicalHeaderKey(key)] = append(h[CanonicalHeaderKey(key)], value)
+}
+
+// Set replaces any existing values associated with key with the single
+// value given, after canonicalizing key.
+func (h Header) Set(key, value string) {
+	h[CanonicalHeaderKey(key)] = []string{value}
+}
+
+// Get returns the first value associated with key, or "" if there is none.
+func (h Header) Get(key string) string {
+	v := h[CanonicalHeaderKey(key)]
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0]
+}
+
+// Del removes the values associated with key.
+func (h Header) Del(key string) {
+	delete(h, CanonicalHeaderKey(key))
+}
+
+// Write serializes h in wire format, one "Key: value\r\n" line per value.
+func (h Header) Write(w io.Writer) error {
+	for k, values := range h {
+		for _, v := range values {
+			if _, err := io.WriteString(w, k+": "+v+"\r\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CanonicalHeaderKey returns the canonical form of a header field name, as
+// used on the wire: the first letter and each letter following a '-' are
+// upper-cased, everything else lower-cased. E.g. "content-length" becomes
+// "Content-Length". This follows the same convention as
+// net/textproto.CanonicalMIMEHeaderKey.
+func CanonicalHeaderKey(s string) string {
+	b := []byte(s)
+	upper := true
+	for i, c := range b {
+		switch {
+		case upper && 'a' <= c && c <= 'z':
+			b[i] = c - ('a' - 'A')
+		case !upper && 'A' <= c && c <= 'Z':
+			b[i] = c + ('a' - 'A')
+		}
+		upper = c == '-'
+	}
+	return string(b)
+}
+
+// readHeaderLine reads one logical header line from reader, folding any
+// RFC 7230 §3.2.4 continuation lines (those starting with SP or HTAB) into
+// it. Folded lines are joined with a single space, per the RFC's
+// recommendation for de-obsoleting line folding.
+func readHeaderLine(reader *bufio.Reader) (string, error) {
+	s, err := ReadLine(reader)
+	if err != nil {
+		return "", err
+	}
+	// The blank line terminating the header block is never a continuation
+	// of anything; stop here so callers see s == "" and don't end up
+	// folding the first line of the body into it.
+	if s == "" {
+		return s, nil
+	}
+	for {
+		b, err := reader.Peek(1)
+		if err != nil || (b[0] != ' ' && b[0] != '\t') {
+			break
+		}
+		cont, err := ReadLine(reader)
+		if err != nil {
+			return "", err
+		}
+		s += " " + strings.TrimSpace(cont)
+	}
+	return s, nil
+}
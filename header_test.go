@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestReadHeaderLineFoldsContinuation(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("Content-Type: text/plain\r\n charset=utf-8\r\n\r\n"))
+	s, err := readHeaderLine(r)
+	if err != nil {
+		t.Fatalf("readHeaderLine: %v", err)
+	}
+	want := "Content-Type: text/plain charset=utf-8"
+	if s != want {
+		t.Errorf("got %q, want %q", s, want)
+	}
+}
+
+func TestReadHeaderLineStopsAtBlankTerminator(t *testing.T) {
+	// Regression test: a body that happens to start with a space or tab
+	// must not be folded into the header block as a bogus continuation
+	// line of the terminating blank line.
+	r := bufio.NewReader(strings.NewReader("Content-Length: 13\r\n\r\n hello world\n"))
+
+	s, err := readHeaderLine(r) // "Content-Length: 13"
+	if err != nil {
+		t.Fatalf("readHeaderLine (header): %v", err)
+	}
+	if s != "Content-Length: 13" {
+		t.Fatalf("got %q, want %q", s, "Content-Length: 13")
+	}
+
+	s, err = readHeaderLine(r) // the blank terminator
+	if err != nil {
+		t.Fatalf("readHeaderLine (terminator): %v", err)
+	}
+	if s != "" {
+		t.Errorf("got %q, want terminator %q", s, "")
+	}
+
+	// The body must still be there for whoever reads it next.
+	rest, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("ReadString: %v", err)
+	}
+	if rest != " hello world\n" {
+		t.Errorf("body got mangled: %q", rest)
+	}
+}
+
+func TestCanonicalHeaderKey(t *testing.T) {
+	cases := map[string]string{
+		"content-length":  "Content-Length",
+		"CONTENT-LENGTH":  "Content-Length",
+		"x-forwarded-for": "X-Forwarded-For",
+		"te":              "Te",
+	}
+	for in, want := range cases {
+		if got := CanonicalHeaderKey(in); got != want {
+			t.Errorf("CanonicalHeaderKey(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestHeaderAddGetMultiValue(t *testing.T) {
+	h := make(Header)
+	h.Add("Set-Cookie", "a=1")
+	h.Add("set-cookie", "b=2")
+
+	if got := h.Get("SET-COOKIE"); got != "a=1" {
+		t.Errorf("Get returned %q, want first value %q", got, "a=1")
+	}
+	if got := len(h["Set-Cookie"]); got != 2 {
+		t.Errorf("expected 2 values under the canonical key, got %d", got)
+	}
+}
@@ -37,7 +37,11 @@ type Response struct {
 	ContLen  int64
 	Chunking bool
 
-	raw bytes.Buffer
+	Header  Header
+	Trailer Header
+
+	raw  bytes.Buffer
+	body io.Reader
 }
 
 func (rp *Response) String() string {
@@ -53,8 +57,6 @@ func (url *URL) String() string {
 	return fmt.Sprintf("%s%s", url.Host, url.Path)
 }
 
-type Header map[string]string
-
 // TODO Rename to protocol error just as the http pkg
 type HttpError struct {
 	msg string
@@ -67,6 +69,7 @@ const (
 	headerTransferEncoding = "transfer-encoding"
 	headerConnection       = "connection"
 	headerProxyConnection  = "proxy-connection"
+	headerTrailer          = "trailer"
 )
 
 func (he *HttpError) Error() string { return he.msg }
@@ -76,6 +79,9 @@ func newHttpError(msg string, err error) *HttpError {
 }
 
 func hostHasPort(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
 	// Common case should has no port, check the last char first
 	if !IsDigit(s[len(s)-1]) {
 		return false
@@ -126,8 +132,19 @@ func ParseRequestURI(rawurl string) (*URL, error) {
 	return &URL{Host: host, Path: path}, nil
 }
 
-// Note header may span more then 1 line, current implementation does not
-// support this
+// ParseAuthorityURI parses the "host:port" authority-form request-target
+// used by the CONNECT method (RFC 7231 §4.3.6). There is no scheme and no
+// path to strip out, just a host that must carry an explicit port.
+func ParseAuthorityURI(rawurl string) (*URL, error) {
+	if !hostHasPort(rawurl) {
+		return nil, &HttpError{"CONNECT request missing port: " + rawurl}
+	}
+	return &URL{Host: rawurl}, nil
+}
+
+// splitHeader splits a single "Name: value" header line into its two
+// fields. Folded continuation lines must already have been joined by
+// readHeaderLine before this is called.
 func splitHeader(s string) []string {
 	f := strings.SplitN(s, ":", 2)
 	for i, _ := range f {
@@ -136,39 +153,38 @@ func splitHeader(s string) []string {
 	return f
 }
 
-// Only add headers that are of interest for a proxy into request's header map
+// parseHeader reads all request headers into r.Header, folding continuation
+// lines as it goes. Connection/Proxy-Connection are special-cased for
+// KeepAlive and stripped from the forwarded raw bytes; everything else is
+// kept in the map so a later filter step can decide what to forward.
 func (r *Request) parseHeader(reader *bufio.Reader) (err error) {
-	// Read request header and body
 	var s string
 	for {
-		if s, err = ReadLine(reader); err != nil {
+		if s, err = readHeaderLine(reader); err != nil {
 			return newHttpError("Reading client request", err)
 		}
+		if s == "" {
+			r.raw.WriteString("\r\n")
+			break
+		}
+
 		f := splitHeader(s)
-		fieldname := strings.ToLower(f[0])
+		if len(f) != 2 {
+			return &HttpError{"malformed header line: " + s}
+		}
+		fieldname, fieldval := f[0], f[1]
+		r.Header.Add(fieldname, fieldval)
+
+		lower := strings.ToLower(fieldname)
 		// RFC2616 only says about "Connection", no "Proxy-Connection", but firefox
 		// send this header.
 		// See more at http://homepage.ntlworld.com/jonathan.deboynepollard/FGA/web-proxy-connection-header.html
-		if fieldname == headerProxyConnection || fieldname == headerConnection {
-			if len(f) != 2 {
-				// TODO For headers like proxy-connection, I guess not client would
-				// make it spread multiple line. But better to support this.
-				return &HttpError{"Multi-line header not supported"}
-			}
-			fieldval := strings.ToLower(f[1])
-			if fieldval == "keep-alive" {
-				r.KeepAlive = true
-			} else {
-				r.KeepAlive = false
-			}
+		if lower == headerProxyConnection || lower == headerConnection {
+			r.KeepAlive = strings.ToLower(strings.TrimSpace(fieldval)) == "keep-alive"
 			continue
 		}
 		r.raw.WriteString(s)
 		r.raw.WriteString("\r\n")
-		// debug.Printf("len %d %s", len(s), s)
-		if s == "" {
-			break
-		}
 	}
 	return nil
 }
@@ -192,15 +208,24 @@ func parseRequest(reader *bufio.Reader) (r *Request, err error) {
 	var requestURI string
 	r.Method, requestURI, r.Proto = f[0], f[1], f[2]
 
-	// Parse URI into host and path
-	r.URL, err = ParseRequestURI(requestURI)
+	// CONNECT uses the authority-form URI (host:port, no scheme, no path)
+	// and is tunneled rather than forwarded as an origin-form request.
+	if r.Method == "CONNECT" {
+		r.URL, err = ParseAuthorityURI(requestURI)
+	} else {
+		r.URL, err = ParseRequestURI(requestURI)
+	}
 	if err != nil {
 		return nil, err
 	}
-	r.genRequestLine()
+	if r.Method != "CONNECT" {
+		r.genRequestLine()
+	}
 
 	// Read request header
-	r.parseHeader(reader)
+	if err = r.parseHeader(reader); err != nil {
+		return nil, err
+	}
 	return r, nil
 }
 
@@ -210,14 +235,14 @@ func (r *Request) genRequestLine() {
 	r.raw.WriteString(r.URL.Path)
 	r.raw.WriteString(" ")
 	r.raw.WriteString("HTTP/1.1\r\n")
-	// TODO remove this after supporting HTTP/1.1 persistent connection
-	r.raw.WriteString("Connection: close\r\n")
+	// Upstream connections are now pooled (see connPool), so ask the server
+	// to keep the socket open instead of closing after every request.
+	r.raw.WriteString("Connection: Keep-Alive\r\n")
 }
 
-var crlfBuf = make([]byte, 2)
-
 func readCheckCRLF(reader *bufio.Reader) error {
-	if _, err := io.ReadFull(reader, crlfBuf); err != nil {
+	var crlfBuf [2]byte
+	if _, err := io.ReadFull(reader, crlfBuf[:]); err != nil {
 		return err
 	}
 	if crlfBuf[0] != '\r' || crlfBuf[1] != '\n' {
@@ -226,12 +251,14 @@ func readCheckCRLF(reader *bufio.Reader) error {
 	return nil
 }
 
-// Only put headers of interest for an proxy into header map
+// parseHeader reads all response headers into rp.Header, folding
+// continuation lines as it goes, so a later filter step can decide what to
+// forward to the client.
 func (rp *Response) parseHeader(reader *bufio.Reader) (err error) {
 	var s string
 	for {
 		// Parse header
-		if s, err = ReadLine(reader); err != nil {
+		if s, err = readHeaderLine(reader); err != nil {
 			return newHttpError("Reading Response header:", err)
 		}
 		if s == "" {
@@ -244,9 +271,15 @@ func (rp *Response) parseHeader(reader *bufio.Reader) (err error) {
 		}
 
 		f := splitHeader(s)
-		fieldname := strings.ToLower(f[0])
+		if len(f) != 2 {
+			return &HttpError{"malformed header line: " + s}
+		}
+		fieldname, fieldval := f[0], f[1]
+		rp.Header.Add(fieldname, fieldval)
+
+		lower := strings.ToLower(fieldname)
 		// Don't pass connection header to client
-		if fieldname != headerConnection {
+		if lower != headerConnection {
 			rp.raw.WriteString(s)
 			rp.raw.WriteString("\r\n")
 		} else {
@@ -255,26 +288,41 @@ func (rp *Response) parseHeader(reader *bufio.Reader) (err error) {
 
 		// Only parse header for Content-Length and Transfer-Encoding
 		if rp.HasBody {
-			if fieldname == headerContentLength {
-				if len(f) != 2 {
-					return &HttpError{"Multi-line header not supported: " + s}
-				}
-				if rp.ContLen, err = strconv.ParseInt(f[1], 10, 64); err != nil {
+			if lower == headerContentLength {
+				if rp.ContLen, err = strconv.ParseInt(strings.TrimSpace(fieldval), 10, 64); err != nil {
 					return newProxyError("Response content-length:", err)
 				}
 				if rp.ContLen == 0 {
 					rp.HasBody = false
 				}
-			} else if fieldname == headerTransferEncoding {
-				fieldval := strings.ToLower(f[1])
-				if fieldval == "chunked" {
+			} else if lower == headerTransferEncoding {
+				if strings.ToLower(strings.TrimSpace(fieldval)) == "chunked" {
 					rp.Chunking = true
 				} else {
 					debug.Printf("transfer-encoding: %s not supported", fieldval)
 				}
+			} else if lower == headerTrailer {
+				// Record the announced trailer field names now; the
+				// chunked reader fills in their values once it reaches
+				// the trailer block at EOF.
+				for _, name := range strings.Split(fieldval, ",") {
+					if name = strings.TrimSpace(name); name != "" {
+						rp.Trailer.Add(name, "")
+					}
+				}
 			}
 		}
 	}
+
+	// reader is now positioned at the start of the body: sniff a
+	// Content-Type if the headers didn't announce one, and remember the
+	// resulting body reader so callers don't have to re-derive it (and
+	// risk re-decoding the chunked/Content-Length framing from scratch).
+	body, err := rp.SniffContentType(rp.BodyReader(reader))
+	if err != nil {
+		return err
+	}
+	rp.body = body
 	return nil
 }
 
@@ -288,6 +336,8 @@ func responseMayHaveBody(method, status string) bool {
 // determine if response may have body, also for debugging
 func parseResponse(reader *bufio.Reader, method string) (rp *Response, err error) {
 	rp = new(Response)
+	rp.Header = make(Header)
+	rp.Trailer = make(Header)
 
 	var s string
 	if s, err = ReadLine(reader); err != nil {
@@ -310,3 +360,60 @@ func parseResponse(reader *bufio.Reader, method string) (rp *Response, err error
 
 	return rp, nil
 }
+
+// BodyReader returns an io.Reader yielding the decoded response body,
+// hiding whether the wire framing is Content-Length or chunked so the
+// forwarding loop doesn't need to care.
+func (rp *Response) BodyReader(reader *bufio.Reader) io.Reader {
+	if !rp.HasBody {
+		return bytes.NewReader(nil)
+	}
+	if rp.Chunking {
+		return newChunkedReader(reader)
+	}
+	return io.LimitReader(reader, rp.ContLen)
+}
+
+// Body returns the body reader parseHeader already built (and possibly
+// wrapped for content-type sniffing). Callers that want the response body
+// should use this instead of calling BodyReader again, which would start
+// decoding the framing a second time from the reader's current position.
+func (rp *Response) Body() io.Reader {
+	return rp.body
+}
+
+// collectTrailer copies trailer values decoded by a chunked body reader
+// into rp.Trailer, replacing the empty placeholders left by the Trailer:
+// announcement. It's a no-op for non-chunked bodies. Call only after body
+// has been fully read (i.e. past io.EOF).
+func (rp *Response) collectTrailer(body io.Reader) {
+	if pr, ok := body.(*peekReader); ok {
+		body = pr.r
+	}
+	cr, ok := body.(*chunkedReader)
+	if !ok || cr.trailer == nil {
+		return
+	}
+	for k, v := range cr.trailer {
+		rp.Trailer[k] = v
+	}
+}
+
+// WriteTrailer writes rp.Trailer to w, but only when clientTE (the
+// client's "TE" request header value) lists "trailers". Otherwise the
+// trailers are silently dropped, per RFC 7230 §4.1.2.
+func (rp *Response) WriteTrailer(w io.Writer, clientTE string) error {
+	if len(rp.Trailer) == 0 || !teWantsTrailers(clientTE) {
+		return nil
+	}
+	return rp.Trailer.Write(w)
+}
+
+func teWantsTrailers(te string) bool {
+	for _, v := range strings.Split(te, ",") {
+		if strings.EqualFold(strings.TrimSpace(v), "trailers") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+)
+
+// Default tunables, chosen to match the ballpark of net/http's Transport
+// defaults. Small enough that a busy proxy won't accumulate thousands of
+// idle sockets, large enough that the common few-hosts-hit-repeatedly case
+// avoids re-dialing.
+const (
+	defaultMaxIdleConnsPerHost = 2
+	defaultMaxIdleConns        = 50
+	defaultIdleConnTimeout     = 60 * time.Second
+)
+
+// idleConn is a parked upstream connection, ready to be reused for the next
+// request to the same host.
+type idleConn struct {
+	conn   net.Conn
+	br     *bufio.Reader
+	bw     *bufio.Writer
+	idleAt time.Time
+}
+
+// connPool keeps idle upstream connections keyed by host (the host:port form
+// held in a request's URL.Host). It mirrors the idle pool inside
+// net/http.Transport, but scoped to what this proxy needs: get one back,
+// put one back, expire the stale ones.
+type connPool struct {
+	mu             sync.Mutex
+	conns          map[string][]*idleConn
+	total          int
+	maxIdlePerHost int
+	maxIdleTotal   int
+	idleTimeout    time.Duration
+}
+
+// newConnPool builds a pool with the given limits. A zero maxIdlePerHost,
+// maxIdleTotal, or idleTimeout falls back to the package default, so
+// callers can override just the knobs they care about.
+func newConnPool(maxIdlePerHost, maxIdleTotal int, idleTimeout time.Duration) *connPool {
+	if maxIdlePerHost == 0 {
+		maxIdlePerHost = defaultMaxIdleConnsPerHost
+	}
+	if maxIdleTotal == 0 {
+		maxIdleTotal = defaultMaxIdleConns
+	}
+	if idleTimeout == 0 {
+		idleTimeout = defaultIdleConnTimeout
+	}
+	return &connPool{
+		conns:          make(map[string][]*idleConn),
+		maxIdlePerHost: maxIdlePerHost,
+		maxIdleTotal:   maxIdleTotal,
+		idleTimeout:    idleTimeout,
+	}
+}
+
+// clientConnPool is the pool used by the proxy for upstream server
+// connections, analogous to http.DefaultTransport's idle pool. Operators
+// can replace it wholesale (e.g. clientConnPool = newConnPool(...)) to
+// configure its limits.
+var clientConnPool = newConnPool(0, 0, 0)
+
+// getIdleConn returns the most recently parked idle connection to host that
+// has not been idle longer than the idle timeout; expired ones it passes over
+// are closed and dropped. Whether the peer still holds the socket open is
+// not checked. The last return value reports whether a connection was found.
+func (p *connPool) getIdleConn(host string) (net.Conn, *bufio.Reader, *bufio.Writer, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	list := p.conns[host]
+	for len(list) > 0 {
+		ic := list[len(list)-1]
+		list = list[:len(list)-1]
+		p.total--
+
+		if time.Since(ic.idleAt) > p.idleTimeout {
+			ic.conn.Close()
+			continue
+		}
+		p.conns[host] = list
+		return ic.conn, ic.br, ic.bw, true
+	}
+	p.conns[host] = list
+	return nil, nil, nil, false
+}
+
+// putIdleConn parks conn for reuse by later requests to host. It refuses
+// (and closes conn) when the per-host or total idle limit is already full.
+func (p *connPool) putIdleConn(host string, conn net.Conn, br *bufio.Reader, bw *bufio.Writer) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.conns[host]) >= p.maxIdlePerHost || p.total >= p.maxIdleTotal {
+		conn.Close()
+		return false
+	}
+	p.conns[host] = append(p.conns[host], &idleConn{conn: conn, br: br, bw: bw, idleAt: time.Now()})
+	p.total++
+	return true
+}
+
+// drainBody consumes whatever is left of rp.Body() so the underlying
+// connection is left at the start of the next response and can be safely
+// handed back to the pool. It understands both Content-Length and chunked
+// framing (trailers included); any read error is a protocol error and the
+// caller should close the connection instead of pooling it.
+func (rp *Response) drainBody() error {
+	if !rp.HasBody {
+		return nil
+	}
+	body := rp.Body()
+	if _, err := io.Copy(ioutil.Discard, body); err != nil {
+		return newHttpError("drainBody: draining response body:", err)
+	}
+	rp.collectTrailer(body)
+	return nil
+}
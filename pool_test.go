@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnPoolPutGetRoundTrip(t *testing.T) {
+	p := newConnPool(2, 10, time.Minute)
+
+	c, _ := net.Pipe()
+	defer c.Close()
+	br := bufio.NewReader(c)
+	bw := bufio.NewWriter(c)
+
+	if !p.putIdleConn("example.com:443", c, br, bw) {
+		t.Fatal("putIdleConn refused a connection within limits")
+	}
+
+	gotConn, gotBr, gotBw, ok := p.getIdleConn("example.com:443")
+	if !ok {
+		t.Fatal("getIdleConn found nothing after a put")
+	}
+	if gotConn != c || gotBr != br || gotBw != bw {
+		t.Error("getIdleConn did not return the exact values that were put")
+	}
+
+	if _, _, _, ok := p.getIdleConn("example.com:443"); ok {
+		t.Error("expected the pool to be empty after the single idle conn was taken")
+	}
+}
+
+func TestConnPoolPerHostLimit(t *testing.T) {
+	p := newConnPool(1, 10, time.Minute)
+
+	c1, _ := net.Pipe()
+	defer c1.Close()
+	c2, _ := net.Pipe()
+	defer c2.Close()
+
+	if !p.putIdleConn("h:443", c1, nil, nil) {
+		t.Fatal("first put should fit within maxIdlePerHost")
+	}
+	if p.putIdleConn("h:443", c2, nil, nil) {
+		t.Error("second put should have been refused by maxIdlePerHost=1")
+	}
+}
+
+func TestConnPoolTotalLimit(t *testing.T) {
+	p := newConnPool(10, 1, time.Minute)
+
+	c1, _ := net.Pipe()
+	defer c1.Close()
+	c2, _ := net.Pipe()
+	defer c2.Close()
+
+	if !p.putIdleConn("a:443", c1, nil, nil) {
+		t.Fatal("first put should fit within maxIdleTotal")
+	}
+	if p.putIdleConn("b:443", c2, nil, nil) {
+		t.Error("second put should have been refused by maxIdleTotal=1")
+	}
+}
+
+func TestConnPoolExpiresIdleConn(t *testing.T) {
+	p := newConnPool(2, 10, time.Millisecond)
+
+	c, _ := net.Pipe()
+	defer c.Close()
+	p.putIdleConn("h:443", c, nil, nil)
+
+	time.Sleep(5 * time.Millisecond)
+
+	if _, _, _, ok := p.getIdleConn("h:443"); ok {
+		t.Error("expected getIdleConn to treat the connection as expired")
+	}
+}
+
+func TestNewConnPoolDefaults(t *testing.T) {
+	p := newConnPool(0, 0, 0)
+	if p.maxIdlePerHost != defaultMaxIdleConnsPerHost {
+		t.Errorf("maxIdlePerHost = %d, want default %d", p.maxIdlePerHost, defaultMaxIdleConnsPerHost)
+	}
+	if p.maxIdleTotal != defaultMaxIdleConns {
+		t.Errorf("maxIdleTotal = %d, want default %d", p.maxIdleTotal, defaultMaxIdleConns)
+	}
+	if p.idleTimeout != defaultIdleConnTimeout {
+		t.Errorf("idleTimeout = %v, want default %v", p.idleTimeout, defaultIdleConnTimeout)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"io"
+)
+
+// sniffLen is how many leading body bytes DetectContentType needs to see,
+// per the WHATWG MIME Sniffing spec.
+const sniffLen = 512
+
+// sniffSig is one entry of the magic-byte signature table used by
+// DetectContentType. fold indicates a case-insensitive match against text
+// (used for the HTML/XML signatures, which real documents prefix with
+// arbitrary case and sometimes leading whitespace).
+type sniffSig struct {
+	contentType string
+	sig         string
+	fold        bool
+}
+
+// sniffTable is checked in order; the first match wins. A '?' byte in sig
+// is a wildcard, used by the WEBP signature to skip over the RIFF chunk
+// size field.
+var sniffTable = []sniffSig{
+	{"application/pdf", "%PDF-", false},
+	{"image/gif", "GIF87a", false},
+	{"image/gif", "GIF89a", false},
+	{"image/png", "\x89PNG\r\n\x1a\n", false},
+	{"image/jpeg", "\xFF\xD8\xFF", false},
+	{"image/webp", "RIFF????WEBP", false},
+	{"text/xml; charset=utf-8", "<?xml", true},
+	{"text/html; charset=utf-8", "<!DOCTYPE html", true},
+	{"text/html; charset=utf-8", "<html", true},
+	{"application/gzip", "\x1F\x8B", false},
+	{"application/zip", "PK\x03\x04", false},
+}
+
+// DetectContentType implements a pragmatic subset of the WHATWG "MIME
+// Sniffing" algorithm: a table of magic byte signatures, falling back to a
+// binary-vs-text classification based on control bytes in the first
+// sniffLen bytes of data. data need not be longer than sniffLen; extra
+// bytes are ignored.
+func DetectContentType(data []byte) string {
+	if len(data) > sniffLen {
+		data = data[:sniffLen]
+	}
+	trimmed := bytes.TrimLeft(data, "\t\n\x0c\r ")
+
+	for _, s := range sniffTable {
+		if s.fold {
+			if matchesFold(trimmed, s.sig) {
+				return s.contentType
+			}
+			continue
+		}
+		if matches(data, s.sig) {
+			return s.contentType
+		}
+	}
+
+	if looksBinary(data) {
+		return "application/octet-stream"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// matches reports whether data starts with sig, treating '?' in sig as a
+// one-byte wildcard.
+func matches(data []byte, sig string) bool {
+	if len(data) < len(sig) {
+		return false
+	}
+	for i := 0; i < len(sig); i++ {
+		if sig[i] == '?' {
+			continue
+		}
+		if data[i] != sig[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesFold is like matches but case-insensitive and without wildcard
+// support, for the HTML/XML text signatures.
+func matchesFold(data []byte, sig string) bool {
+	if len(data) < len(sig) {
+		return false
+	}
+	for i := 0; i < len(sig); i++ {
+		c := data[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		want := sig[i]
+		if 'A' <= want && want <= 'Z' {
+			want += 'a' - 'A'
+		}
+		if c != want {
+			return false
+		}
+	}
+	return true
+}
+
+// looksBinary scans data for bytes the WHATWG spec considers binary
+// (control characters other than tab, LF, FF, CR and escape), which is
+// enough to tell apart plain text from arbitrary binary content.
+func looksBinary(data []byte) bool {
+	for _, c := range data {
+		switch {
+		case c <= 0x08, c == 0x0B, c >= 0x0E && c <= 0x1A, c >= 0x1C && c <= 0x1F:
+			return true
+		}
+	}
+	return false
+}
+
+// peekReader buffers up to n bytes read from r so they can be inspected
+// (e.g. sniffed for a content type) without losing them for whoever reads
+// the stream afterwards: Read drains the buffer first, then falls through
+// to r once it's exhausted.
+type peekReader struct {
+	buf []byte
+	r   io.Reader
+}
+
+// newPeekReader reads up to n bytes from r into an internal buffer and
+// returns a reader that replays them before continuing from r. A short
+// read (including immediate EOF) is not an error: Peeked simply returns
+// fewer bytes.
+func newPeekReader(r io.Reader, n int) (*peekReader, error) {
+	buf := make([]byte, n)
+	got, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return &peekReader{buf: buf[:got], r: r}, nil
+}
+
+// Peeked returns the buffered bytes available for inspection.
+func (pr *peekReader) Peeked() []byte {
+	return pr.buf
+}
+
+func (pr *peekReader) Read(p []byte) (int, error) {
+	if len(pr.buf) > 0 {
+		n := copy(p, pr.buf)
+		pr.buf = pr.buf[n:]
+		return n, nil
+	}
+	return pr.r.Read(p)
+}
+
+// SniffContentType checks whether the response announced a Content-Type;
+// if not, it peeks at the first sniffLen bytes of body, detects one, and
+// injects a synthesized "Content-Type:" line into rp.raw ahead of the
+// header-terminating blank line. It returns the reader the caller should
+// now use to forward the body, since the sniffed bytes must not be lost.
+func (rp *Response) SniffContentType(body io.Reader) (io.Reader, error) {
+	if !rp.HasBody || rp.Header.Get("Content-Type") != "" {
+		return body, nil
+	}
+
+	pr, err := newPeekReader(body, sniffLen)
+	if err != nil {
+		return nil, newHttpError("sniffing content-type:", err)
+	}
+	ct := DetectContentType(pr.Peeked())
+
+	raw := rp.raw.Bytes()
+	if bytes.HasSuffix(raw, []byte("\r\n\r\n")) {
+		rp.raw.Truncate(rp.raw.Len() - 2)
+	}
+	rp.raw.WriteString("Content-Type: " + ct + "\r\n")
+	rp.raw.WriteString("\r\n")
+	rp.Header.Set("Content-Type", ct)
+
+	return pr, nil
+}
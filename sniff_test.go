@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestDetectContentType(t *testing.T) {
+	testCases := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"pdf", []byte("%PDF-1.4 ..."), "application/pdf"},
+		{"gif87", []byte("GIF87a..."), "image/gif"},
+		{"gif89", []byte("GIF89a..."), "image/gif"},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00"), "image/png"},
+		{"jpeg", []byte("\xFF\xD8\xFF\xE0"), "image/jpeg"},
+		{"webp", []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), "image/webp"},
+		{"xml", []byte("<?xml version=\"1.0\"?>"), "text/xml; charset=utf-8"},
+		{"xml uppercase", []byte("<?XML version=\"1.0\"?>"), "text/xml; charset=utf-8"},
+		{"doctype html", []byte("<!DOCTYPE html><html></html>"), "text/html; charset=utf-8"},
+		{"html with leading whitespace", []byte("\n  <html><body></body></html>"), "text/html; charset=utf-8"},
+		{"gzip", []byte("\x1F\x8B\x08\x00"), "application/gzip"},
+		{"zip", []byte("PK\x03\x04\x14\x00"), "application/zip"},
+		{"plain text", []byte("just some ordinary text"), "text/plain; charset=utf-8"},
+		{"empty", []byte(""), "text/plain; charset=utf-8"},
+		{"binary fallback", []byte("\x00\x01\x02binary junk"), "application/octet-stream"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := DetectContentType(tc.data); got != tc.want {
+				t.Errorf("DetectContentType(%q) = %q, want %q", tc.data, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDetectContentTypeOnlyLooksAtSniffLen(t *testing.T) {
+	// A control byte past the 512-byte sniff window must not flip the
+	// verdict to binary.
+	data := append([]byte(strings.Repeat("a", sniffLen)), 0x00)
+	if got := DetectContentType(data); got != "text/plain; charset=utf-8" {
+		t.Errorf("DetectContentType with trailing control byte past sniffLen = %q, want text/plain", got)
+	}
+}
+
+func TestMatchesWildcard(t *testing.T) {
+	if !matches([]byte("RIFF1234WEBPVP8 "), "RIFF????WEBP") {
+		t.Error("expected RIFF????WEBP to match a RIFF/WEBP header with wildcard size bytes")
+	}
+	if matches([]byte("RIFF1234AVI garbage"), "RIFF????WEBP") {
+		t.Error("did not expect a non-WEBP RIFF container to match")
+	}
+}
+
+func TestMatchesFoldCaseInsensitive(t *testing.T) {
+	if !matchesFold([]byte("<HTML><body>"), "<html") {
+		t.Error("expected matchesFold to be case-insensitive")
+	}
+	if matchesFold([]byte("<htm"), "<html") {
+		t.Error("expected matchesFold to reject a short input")
+	}
+}
+
+func TestPeekReaderReplaysBufferedBytes(t *testing.T) {
+	src := strings.NewReader("hello world")
+	pr, err := newPeekReader(src, 5)
+	if err != nil {
+		t.Fatalf("newPeekReader: %v", err)
+	}
+	if got := string(pr.Peeked()); got != "hello" {
+		t.Fatalf("Peeked() = %q, want %q", got, "hello")
+	}
+	rest, err := ioutil.ReadAll(pr)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if got := string(rest); got != "hello world" {
+		t.Errorf("ReadAll after peek = %q, want the full original stream %q", got, "hello world")
+	}
+}
+
+func TestPeekReaderShortBodyIsNotAnError(t *testing.T) {
+	pr, err := newPeekReader(strings.NewReader("hi"), 512)
+	if err != nil {
+		t.Fatalf("newPeekReader on short body: %v", err)
+	}
+	if got := string(pr.Peeked()); got != "hi" {
+		t.Errorf("Peeked() = %q, want %q", got, "hi")
+	}
+}
+
+func TestResponseSniffContentTypeInjectsHeader(t *testing.T) {
+	rp := new(Response)
+	rp.HasBody = true
+	rp.Header = make(Header)
+	rp.raw.WriteString("HTTP/1.1 200 OK\r\n")
+	rp.raw.WriteString("\r\n")
+
+	body, err := rp.SniffContentType(strings.NewReader("<html><body>hi</body></html>"))
+	if err != nil {
+		t.Fatalf("SniffContentType: %v", err)
+	}
+
+	if got := rp.Header.Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("Header.Get(Content-Type) = %q, want text/html", got)
+	}
+	if !strings.Contains(rp.raw.String(), "Content-Type: text/html; charset=utf-8\r\n") {
+		t.Errorf("raw header block missing injected Content-Type: %q", rp.raw.String())
+	}
+	if !strings.HasSuffix(rp.raw.String(), "\r\n\r\n") {
+		t.Errorf("raw header block no longer terminated by a blank line: %q", rp.raw.String())
+	}
+
+	rest, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatalf("reading returned body: %v", err)
+	}
+	if got := string(rest); got != "<html><body>hi</body></html>" {
+		t.Errorf("sniffed bytes were lost: got %q", got)
+	}
+}
+
+func TestResponseSniffContentTypeSkipsWhenAlreadySet(t *testing.T) {
+	rp := new(Response)
+	rp.HasBody = true
+	rp.Header = make(Header)
+	rp.Header.Set("Content-Type", "application/json")
+	rp.raw.WriteString("HTTP/1.1 200 OK\r\n\r\n")
+
+	in := bufio.NewReader(strings.NewReader("not actually json"))
+	body, err := rp.SniffContentType(in)
+	if err != nil {
+		t.Fatalf("SniffContentType: %v", err)
+	}
+	if strings.Contains(rp.raw.String(), "Content-Type:") {
+		t.Errorf("should not have injected a Content-Type when one was already set: %q", rp.raw.String())
+	}
+	if body != io.Reader(in) {
+		t.Error("expected the original reader back unchanged when Content-Type was already set")
+	}
+}